@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/go-ini/ini"
 
@@ -35,22 +36,75 @@ type KnownBrothers struct {
 	Servers map[string]string
 }
 
+type AllowedOrigins struct {
+	Patterns map[string]string
+}
+
+type Carrier struct {
+	Backends map[string]string
+}
+
 type HTTPServerConfig struct {
-	ReadBufferSize   int
-	WriteBufferSize  int
-	HandshakeTimeout int
+	ReadBufferSize    int
+	WriteBufferSize   int
+	HandshakeTimeout  int
+	EnableCompression bool
+	CompressionLevel  int
+	MaxRetries        int
+	BaseBackoff       int // milliseconds; convert with BaseBackoffDuration before assigning to Manager.BaseBackoff
+	MaxBackoff        int // milliseconds; convert with MaxBackoffDuration before assigning to Manager.MaxBackoff
+}
+
+// BaseBackoffDuration converts BaseBackoff (milliseconds) to a
+// time.Duration, as expected by HTTPServer.Manager.BaseBackoff.
+func (c HTTPServerConfig) BaseBackoffDuration() time.Duration {
+	return time.Duration(c.BaseBackoff) * time.Millisecond
+}
+
+// MaxBackoffDuration converts MaxBackoff (milliseconds) to a time.Duration,
+// as expected by HTTPServer.Manager.MaxBackoff.
+func (c HTTPServerConfig) MaxBackoffDuration() time.Duration {
+	return time.Duration(c.MaxBackoff) * time.Millisecond
 }
 
 type TCPServerConfig struct {
 	ConnectTimeOut           int
 	WriteTimeOut             int
 	ScalingCheckServerPeriod int
+	MaxRetries               int
+	BaseBackoff              int // milliseconds; convert with BaseBackoffDuration before use
+	MaxBackoff               int // milliseconds; convert with MaxBackoffDuration before use
+}
+
+// BaseBackoffDuration converts BaseBackoff (milliseconds) to a
+// time.Duration.
+func (c TCPServerConfig) BaseBackoffDuration() time.Duration {
+	return time.Duration(c.BaseBackoff) * time.Millisecond
+}
+
+// MaxBackoffDuration converts MaxBackoff (milliseconds) to a time.Duration.
+func (c TCPServerConfig) MaxBackoffDuration() time.Duration {
+	return time.Duration(c.MaxBackoff) * time.Millisecond
 }
 
 type Encryption struct {
 	HASH_SIZE int
 	HEX_KEY   string
 	HEX_IV    string
+	// RSA_PUBLIC_KEY_PEM, when set, verifies RS*-signed JWTs with this PEM
+	// encoded RSA public key instead of the HS*/HEX_KEY path. Leave empty
+	// to keep verifying HMAC-signed tokens.
+	RSA_PUBLIC_KEY_PEM string
+}
+
+type RedisConfig struct {
+	Addr          string
+	Password      string
+	DB            int
+	ChannelPrefix string
+	Mode          string
+	StateKey      string
+	PollPeriod    int
 }
 
 type Data struct {
@@ -59,9 +113,12 @@ type Data struct {
 	ConnectionLimit
 	ServersAddresses
 	KnownBrothers
+	AllowedOrigins
+	Carrier
 	HTTPServerConfig
 	TCPServerConfig
 	Encryption
+	RedisConfig `ini:"Redis"`
 }
 
 func Load() (*Data, error) {
@@ -79,21 +136,38 @@ func Load() (*Data, error) {
 		},
 		ServersAddresses{},
 		KnownBrothers{},
+		AllowedOrigins{},
+		Carrier{},
 		HTTPServerConfig{
-			ReadBufferSize:   4096,
-			WriteBufferSize:  4096,
-			HandshakeTimeout: 5,
+			ReadBufferSize:    4096,
+			WriteBufferSize:   4096,
+			HandshakeTimeout:  5,
+			EnableCompression: false,
+			CompressionLevel:  1,
+			MaxRetries:        0,
+			BaseBackoff:       100,
+			MaxBackoff:        30000,
 		},
 		TCPServerConfig{
 			ConnectTimeOut:           2,
 			WriteTimeOut:             1,
 			ScalingCheckServerPeriod: 10,
+			MaxRetries:               0,
+			BaseBackoff:              100,
+			MaxBackoff:               30000,
 		},
 		Encryption{
 			HASH_SIZE: 8,
 			HEX_KEY:   "0000000000000000000000000000000000000000000000000000000000000000",
 			HEX_IV:    "00000000000000000000000000000000",
 		},
+		RedisConfig{
+			Addr:          "localhost:6379",
+			DB:            0,
+			ChannelPrefix: "polycom:",
+			Mode:          "pubsub",
+			PollPeriod:    10,
+		},
 	}
 
 	conf.HTTPaddr = *flag.String("httpaddr", "localhost:8080", "http service address")
@@ -111,5 +185,15 @@ func Load() (*Data, error) {
 	if err == nil {
 		conf.KnownBrothers.Servers = sec1.KeysHash()
 	}
+
+	sec2, err := cfg.GetSection("AllowedOrigins")
+	if err == nil {
+		conf.AllowedOrigins.Patterns = sec2.KeysHash()
+	}
+
+	sec3, err := cfg.GetSection("Carrier")
+	if err == nil {
+		conf.Carrier.Backends = sec3.KeysHash()
+	}
 	return conf, err
 }
\ No newline at end of file
@@ -0,0 +1,13 @@
+package Hub
+
+// Broadcast sends payload to every local client, the same as sending
+// directly on h.broadcast, and additionally republishes it to Redis when a
+// RedisBridge is attached via NewRedisBridge. Existing call sites that send
+// on h.broadcast directly should migrate to h.Broadcast(payload); otherwise
+// locally originated messages never reach sibling nodes over Redis.
+func (h *Hub) Broadcast(payload []byte) {
+	h.broadcast <- payload
+	if b := bridgeFor(h); b != nil {
+		b.publish(payload)
+	}
+}
@@ -0,0 +1,7 @@
+package Hub
+
+// CallToAction is invoked by HTTPServer.Reader for every inbound message.
+// messageType is the gorilla websocket opcode (websocket.TextMessage or
+// websocket.BinaryMessage) so handlers can dispatch accordingly instead of
+// assuming every frame carries text.
+type CallToAction func(c *Client, messageType int, message []byte)
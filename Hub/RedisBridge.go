@@ -0,0 +1,175 @@
+package Hub
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/Djoulzy/Polycom/CLog"
+	"github.com/Djoulzy/Polycom/Config"
+)
+
+// originIDSize is the length, in bytes, of the random node ID prefixed to
+// every payload published to Redis so subscribe() can recognize and drop
+// this node's own broadcasts instead of looping them back to its clients.
+const originIDSize = 16
+
+// RedisBridge fans broadcasts out to sibling Polycom nodes through Redis,
+// turning the KnownBrothers full-mesh into an optional pub/sub topology:
+// it forwards payloads received on the Redis channel onto this Hub's
+// broadcast channel, and republishes locally originated broadcasts (sent
+// via Hub.Broadcast) back to Redis so siblings pick them up. Redis pub/sub
+// delivers every publish to every subscriber of the channel, including the
+// publisher itself, so each published payload is tagged with a random
+// per-bridge originID; subscribe() strips it off and discards messages
+// that originated from this same bridge, since those were already
+// delivered to h.broadcast directly by Hub.Broadcast.
+type RedisBridge struct {
+	hub      *Hub
+	client   *redis.Client
+	channel  string
+	conf     *Config.RedisConfig
+	quit     chan struct{}
+	originID [originIDSize]byte
+}
+
+// bridges tracks the RedisBridge attached to each Hub, if any, so
+// Hub.Broadcast can republish to Redis without every Hub needing a
+// dedicated field for it.
+var bridges = struct {
+	sync.RWMutex
+	m map[*Hub]*RedisBridge
+}{m: make(map[*Hub]*RedisBridge)}
+
+func bridgeFor(h *Hub) *RedisBridge {
+	bridges.RLock()
+	defer bridges.RUnlock()
+	return bridges.m[h]
+}
+
+// NewRedisBridge wires a RedisBridge between h and the Redis instance
+// described by conf, and attaches it to h so that h.Broadcast(...)
+// republishes locally originated broadcasts to Redis.
+func NewRedisBridge(h *Hub, conf *Config.RedisConfig) *RedisBridge {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.Addr,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+
+	b := &RedisBridge{
+		hub:     h,
+		client:  client,
+		channel: fmt.Sprintf("%sbroadcast", conf.ChannelPrefix),
+		conf:    conf,
+		quit:    make(chan struct{}),
+	}
+	if _, err := rand.Read(b.originID[:]); err != nil {
+		// crypto/rand failing is effectively fatal here: a predictable or
+		// shared originID would defeat the self-origin check in subscribe()
+		// and reintroduce the double-delivery bug it exists to prevent.
+		panic(fmt.Sprintf("RedisBridge: failed to generate originID: %s", err))
+	}
+
+	bridges.Lock()
+	bridges.m[h] = b
+	bridges.Unlock()
+
+	return b
+}
+
+// Start launches the bridge's background goroutine. In "state" mode it
+// polls conf.StateKey every conf.PollPeriod seconds and only rebroadcasts
+// when the value changes (dedup via last-seen value); any other mode
+// subscribes to the pub/sub channel.
+func (b *RedisBridge) Start() {
+	if b.conf.Mode == "state" {
+		go b.pollState()
+	} else {
+		go b.subscribe()
+	}
+}
+
+// Stop terminates the bridge's background goroutine and detaches it from
+// its Hub.
+func (b *RedisBridge) Stop() {
+	close(b.quit)
+	bridges.Lock()
+	delete(bridges.m, b.hub)
+	bridges.Unlock()
+}
+
+// publish republishes a locally originated broadcast to Redis so sibling
+// nodes pick it up, prefixed with this bridge's originID so subscribe() can
+// recognize and drop it on this node instead of delivering it twice. It is
+// called by Hub.Broadcast, not directly.
+func (b *RedisBridge) publish(payload []byte) {
+	framed := make([]byte, originIDSize+len(payload))
+	copy(framed, b.originID[:])
+	copy(framed[originIDSize:], payload)
+	if err := b.client.Publish(b.channel, framed).Err(); err != nil {
+		clog.Error("RedisBridge", "publish", "Publish on %s failed: %s", b.channel, err)
+	}
+}
+
+func (b *RedisBridge) subscribe() {
+	pubsub := b.client.Subscribe(b.channel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			payload := []byte(msg.Payload)
+			if len(payload) < originIDSize {
+				clog.Warn("RedisBridge", "subscribe", "Dropping undersized message on %s", b.channel)
+				continue
+			}
+			if bytes.Equal(payload[:originIDSize], b.originID[:]) {
+				// Our own publish, looped back by Redis: already delivered
+				// to h.broadcast directly by Hub.Broadcast.
+				continue
+			}
+			b.hub.broadcast <- payload[originIDSize:]
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+func (b *RedisBridge) pollState() {
+	period := time.Duration(b.conf.PollPeriod) * time.Second
+	if period <= 0 {
+		period = 10 * time.Second
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var lastSeen string
+	for {
+		select {
+		case <-ticker.C:
+			value, err := b.client.Get(b.conf.StateKey).Result()
+			if err != nil {
+				if err != redis.Nil {
+					clog.Error("RedisBridge", "pollState", "Get %s failed: %s", b.conf.StateKey, err)
+				}
+				continue
+			}
+			if value == lastSeen {
+				continue
+			}
+			lastSeen = value
+			b.hub.broadcast <- []byte(value)
+		case <-b.quit:
+			return
+		}
+	}
+}
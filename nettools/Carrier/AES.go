@@ -0,0 +1,61 @@
+package Carrier
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// ivSize is the AES-CFB IV length: one cipher block.
+const ivSize = aes.BlockSize
+
+// NewIV generates a fresh random IV for WrapAES. CFB, like any stream
+// cipher mode, leaks the XOR of two plaintexts if the same key/IV pair is
+// ever reused, so callers must generate a new IV per connection (see
+// StartClient/handle, which exchange it with the peer as a handshake
+// prefix) instead of reusing Config.Encryption.HEX_IV across sessions.
+func NewIV() ([]byte, error) {
+	iv := make([]byte, ivSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	return iv, nil
+}
+
+// WrapAES wraps rw with an AES-CFB stream cipher keyed by the hex-encoded
+// key from Config.Encryption (HEX_KEY) and the given iv, giving the
+// tunneled bytes an outer encryption layer independent of whatever the
+// wrapped protocol does on its own. iv must be freshly generated per
+// connection with NewIV and shared with the peer; it is no longer read
+// from config, since a static IV reused across sessions breaks CFB's
+// security guarantees. Pass the result to StartClient/StartServer instead
+// of the raw net.Conn/stdio when the operator wants this extra layer.
+func WrapAES(rw io.ReadWriter, hexKey string, iv []byte) (io.ReadWriter, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, fmt.Errorf("Carrier: AES IV must be %d bytes, got %d", block.BlockSize(), len(iv))
+	}
+
+	return &aesReadWriter{
+		r: &cipher.StreamReader{S: cipher.NewCFBDecrypter(block, iv), R: rw},
+		w: &cipher.StreamWriter{S: cipher.NewCFBEncrypter(block, iv), W: rw},
+	}, nil
+}
+
+type aesReadWriter struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (c *aesReadWriter) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *aesReadWriter) Write(p []byte) (int, error) { return c.w.Write(p) }
@@ -0,0 +1,231 @@
+package Carrier
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Djoulzy/Polycom/CLog"
+	"github.com/Djoulzy/Polycom/Config"
+	"github.com/Djoulzy/Polycom/nettools/HTTPServer"
+)
+
+const (
+	idleTimeout = 5 * time.Minute
+	dialTimeout = 5 * time.Second
+	pumpBufSize = 32 * 1024
+	pathPrefix  = "/carrier/"
+)
+
+// StartClient dials originURL as a websocket and pumps bytes bidirectionally
+// between it and rw (a local net.Conn or stdio), wrapping the Polycom
+// websocket as a generic TCP/stdio carrier for SSH, SMTP or any raw
+// protocol, not just Polycom's own message frames. When enc is non-nil, a
+// fresh IV is generated and sent to the server as the first websocket
+// frame, and rw is wrapped with an outer AES-CFB layer keyed by
+// enc.HEX_KEY and that IV before anything else is read from or written to
+// it; a static configured IV would be reused across every session sharing
+// enc, breaking CFB's security guarantees.
+func StartClient(originURL string, rw io.ReadWriter, enc *Config.Encryption) error {
+	conn, _, err := websocket.DefaultDialer.Dial(originURL, nil)
+	if err != nil {
+		clog.Error("Carrier", "StartClient", "Dial %s: %s", originURL, err)
+		return err
+	}
+	defer conn.Close()
+
+	if enc != nil {
+		iv, err := NewIV()
+		if err != nil {
+			clog.Error("Carrier", "StartClient", "Generate IV: %s", err)
+			return err
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, iv); err != nil {
+			clog.Error("Carrier", "StartClient", "Send IV: %s", err)
+			return err
+		}
+		wrapped, err := WrapAES(rw, enc.HEX_KEY, iv)
+		if err != nil {
+			clog.Error("Carrier", "StartClient", "AES setup: %s", err)
+			return err
+		}
+		rw = wrapped
+	}
+
+	pump(conn, rw)
+	return nil
+}
+
+// StartServer listens on listenAddr and, for every accepted TCP connection,
+// dials originURL as a websocket and pumps bytes between the two. This is
+// the client-side half of the tunnel, e.g. for use as an `ssh -o
+// ProxyCommand` target. enc is forwarded to StartClient for each connection.
+func StartServer(listenAddr, originURL string, enc *Config.Encryption) error {
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		clog.Error("Carrier", "StartServer", "Listen %s: %s", listenAddr, err)
+		return err
+	}
+	clog.Info("Carrier", "StartServer", "Listening on %s, tunneling to %s", listenAddr, originURL)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			clog.Error("Carrier", "StartServer", "Accept: %s", err)
+			continue
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			if err := StartClient(originURL, c, enc); err != nil {
+				clog.Error("Carrier", "StartServer", "Carrier session failed: %s", err)
+			}
+		}(conn)
+	}
+}
+
+// ServerManager handles the server side of the tunnel: it upgrades requests
+// under /carrier/{name}, looks up the matching backend TCP address and
+// pumps bytes both ways. Tunneling into an internal TCP backend is at least
+// as sensitive as the HTTPServer websocket endpoint, so an Authenticator is
+// required: without one every origin and request is refused, matching the
+// Origin allow-list/JWT check HTTPServer.Manager enforces on its own
+// upgrade. When Encryption is non-nil, the backend connection is wrapped
+// with an outer AES-CFB layer keyed by Encryption.HEX_KEY and the
+// per-connection IV the client sends as its first websocket frame.
+type ServerManager struct {
+	Backends      map[string]string
+	Upgrader      websocket.Upgrader
+	Authenticator HTTPServer.Authenticator
+	Encryption    *Config.Encryption
+}
+
+// Start registers the /carrier/ handler on the default ServeMux, mirroring
+// HTTPServer.Manager.Start's use of http.HandleFunc.
+func (s *ServerManager) Start() {
+	checkOrigin := func(r *http.Request) bool { return false }
+	if a, ok := s.Authenticator.(*HTTPServer.JWTAuthenticator); ok {
+		checkOrigin = a.CheckOrigin
+	}
+
+	s.Upgrader = websocket.Upgrader{
+		CheckOrigin: checkOrigin,
+	}
+	http.HandleFunc(pathPrefix, s.handle)
+}
+
+func (s *ServerManager) handle(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, pathPrefix)
+	backend, ok := s.Backends[name]
+	if !ok {
+		clog.Warn("Carrier", "handle", "No backend configured for %s", name)
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.Authenticator == nil {
+		clog.Error("Carrier", "handle", "No Authenticator configured, refusing connection")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if _, ok := s.Authenticator.Authenticate(r); !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	wsConn, err := s.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		clog.Error("Carrier", "handle", "%s", err)
+		return
+	}
+	defer wsConn.Close()
+
+	tcpConn, err := net.DialTimeout("tcp", backend, dialTimeout)
+	if err != nil {
+		clog.Error("Carrier", "handle", "Dial backend %s: %s", backend, err)
+		wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "backend unreachable"))
+		return
+	}
+	defer tcpConn.Close()
+
+	var backendConn io.ReadWriter = tcpConn
+	if s.Encryption != nil {
+		_, iv, err := wsConn.ReadMessage()
+		if err != nil {
+			clog.Error("Carrier", "handle", "Read IV handshake: %s", err)
+			return
+		}
+		wrapped, err := WrapAES(backendConn, s.Encryption.HEX_KEY, iv)
+		if err != nil {
+			clog.Error("Carrier", "handle", "AES setup: %s", err)
+			wsConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "encryption setup failed"))
+			return
+		}
+		backendConn = wrapped
+	}
+
+	pump(wsConn, backendConn)
+}
+
+// pump copies bytes bidirectionally between ws and rw until either side
+// closes or idleTimeout elapses without traffic on either side. EOF on the
+// rw side sends a normal closure frame on ws; a close frame or read error on
+// the ws side half-closes rw's write side (TCPConn.CloseWrite) when rw
+// supports it, rather than closing rw outright. Once a close frame has been
+// received, gorilla has already answered it, so the next write of bytes read
+// from rw to ws fails and ends the session.
+//
+// rw (a net.Conn, stdio, ...) isn't guaranteed to support read deadlines, so
+// idleness is enforced with a watchdog timer instead: it is reset on every
+// byte moved in either direction, and firing closes both ws and rw, which
+// unblocks whichever side is parked in a blocking read.
+func pump(ws *websocket.Conn, rw io.ReadWriter) {
+	idle := time.AfterFunc(idleTimeout, func() {
+		ws.Close()
+		if c, ok := rw.(io.Closer); ok {
+			c.Close()
+		}
+	})
+	defer idle.Stop()
+
+	wsDone := make(chan struct{})
+
+	go func() {
+		defer close(wsDone)
+		for {
+			_, message, err := ws.ReadMessage()
+			if err != nil {
+				if cw, ok := rw.(interface{ CloseWrite() error }); ok {
+					cw.CloseWrite()
+				}
+				return
+			}
+			idle.Reset(idleTimeout)
+			if _, err := rw.Write(message); err != nil {
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, pumpBufSize)
+	for {
+		n, err := rw.Read(buf)
+		if n > 0 {
+			idle.Reset(idleTimeout)
+			if werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+				break
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			}
+			break
+		}
+	}
+
+	<-wsDone
+}
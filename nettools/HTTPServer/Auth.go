@@ -0,0 +1,156 @@
+package HTTPServer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/Djoulzy/Polycom/CLog"
+	"github.com/Djoulzy/Polycom/Config"
+)
+
+// Identity is the trusted client identity extracted by an Authenticator.
+// Its fields map directly onto the Hub.Client fields they should populate.
+type Identity struct {
+	Name    string
+	AppID   string
+	Country string
+	FrontID string
+}
+
+// Authenticator is invoked before Upgrader.Upgrade for every incoming
+// websocket request. A false return refuses the upgrade.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, bool)
+}
+
+// JWTAuthenticator matches the request Origin against a glob allow-list and
+// validates a JWT carried either in the Authorization: Bearer header or in
+// a token query parameter. Claims "sub", "app_id", "country" and "front_id"
+// populate the returned Identity.
+type JWTAuthenticator struct {
+	AllowedOrigins []string
+	Keyfunc        jwt.Keyfunc
+}
+
+// NewJWTAuthenticator builds a JWTAuthenticator from conf: the allow-list
+// comes from conf.AllowedOrigins.Patterns (a name->pattern map, as loaded by
+// Config.Load) and the Keyfunc verifies a signature using the Encryption
+// block, either an RSA public key (conf.Encryption.RSA_PUBLIC_KEY_PEM, for
+// RS*-signed tokens) or an HMAC key (conf.Encryption.HEX_KEY, for
+// HS*-signed tokens) if no RSA key is configured.
+func NewJWTAuthenticator(conf *Config.Data) (*JWTAuthenticator, error) {
+	patterns := make([]string, 0, len(conf.AllowedOrigins.Patterns))
+	for _, pattern := range conf.AllowedOrigins.Patterns {
+		patterns = append(patterns, pattern)
+	}
+
+	keyfunc, err := encryptionKeyfunc(&conf.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTAuthenticator{
+		AllowedOrigins: patterns,
+		Keyfunc:        keyfunc,
+	}, nil
+}
+
+// encryptionKeyfunc builds a jwt.Keyfunc from the Encryption block: an RSA
+// public key from RSA_PUBLIC_KEY_PEM if set, verifying RS*-signed tokens,
+// otherwise an HMAC key from HEX_KEY, verifying HS*-signed tokens.
+func encryptionKeyfunc(enc *Config.Encryption) (jwt.Keyfunc, error) {
+	if enc.RSA_PUBLIC_KEY_PEM != "" {
+		pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(enc.RSA_PUBLIC_KEY_PEM))
+		if err != nil {
+			return nil, fmt.Errorf("HTTPServer: invalid Encryption.RSA_PUBLIC_KEY_PEM: %s", err)
+		}
+		return func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return pub, nil
+		}, nil
+	}
+
+	key, err := hex.DecodeString(enc.HEX_KEY)
+	if err != nil {
+		return nil, fmt.Errorf("HTTPServer: invalid Encryption.HEX_KEY: %s", err)
+	}
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key, nil
+	}, nil
+}
+
+// CheckOrigin matches r's Origin header against the configured glob
+// patterns. An empty allow-list refuses every origin.
+func (a *JWTAuthenticator) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	for _, pattern := range a.AllowedOrigins {
+		if ok, err := path.Match(pattern, origin); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// Authenticate implements Authenticator.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, bool) {
+	if !a.CheckOrigin(r) {
+		clog.Warn("HTTPServer", "Authenticate", "Origin %s refused", r.Header.Get("Origin"))
+		return nil, false
+	}
+
+	tokenString := bearerToken(r)
+	if tokenString == "" {
+		clog.Warn("HTTPServer", "Authenticate", "No token in request")
+		return nil, false
+	}
+
+	token, err := jwt.Parse(tokenString, a.Keyfunc)
+	if err != nil || !token.Valid {
+		clog.Warn("HTTPServer", "Authenticate", "Invalid token: %s", err)
+		return nil, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, false
+	}
+
+	identity := &Identity{
+		Name:    claimString(claims, "sub"),
+		AppID:   claimString(claims, "app_id"),
+		Country: claimString(claims, "country"),
+		FrontID: claimString(claims, "front_id"),
+	}
+	if identity.Name == "" {
+		clog.Warn("HTTPServer", "Authenticate", "Token missing sub claim")
+		return nil, false
+	}
+	return identity, true
+}
+
+func claimString(claims jwt.MapClaims, key string) string {
+	if v, ok := claims[key].(string); ok {
+		return v
+	}
+	return ""
+}
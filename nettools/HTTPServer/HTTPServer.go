@@ -2,12 +2,15 @@ package HTTPServer
 
 import (
 	"bytes"
+	"context"
 	"github.com/gorilla/websocket"
 	"html/template"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Djoulzy/Polycom/CLog"
 	"github.com/Djoulzy/Polycom/Hub"
@@ -21,19 +24,44 @@ const (
 	maxMessageSize = 512
 )
 
+// expectedCloseCodes are the close codes that end a connection normally and
+// should not be logged as a protocol warning.
+var expectedCloseCodes = []int{
+	websocket.CloseNormalClosure,
+	websocket.CloseGoingAway,
+	websocket.CloseNoStatusReceived,
+}
+
 var (
 	Newline = []byte{'\r', '\n'}
 	Space   = []byte{' '}
 )
 
 type Manager struct {
-	Httpaddr         string
-	ServerName       string
-	Upgrader         websocket.Upgrader
-	Hub              *Hub.Hub
-	ReadBufferSize   int
-	WriteBufferSize  int
-	HandshakeTimeout int
+	Httpaddr          string
+	ServerName        string
+	Upgrader          websocket.Upgrader
+	Hub               *Hub.Hub
+	ReadBufferSize    int
+	WriteBufferSize   int
+	HandshakeTimeout  int
+	EnableCompression bool
+	CompressionLevel  int
+	MaxRetries        int
+	BaseBackoff       time.Duration // from Config.HTTPServerConfig.BaseBackoffDuration(), not the raw milliseconds int
+	MaxBackoff        time.Duration // from Config.HTTPServerConfig.MaxBackoffDuration(), not the raw milliseconds int
+	OnReconnect       func(*websocket.Conn)
+	Authenticator     Authenticator
+}
+
+// ConnectOpts overrides the Manager's retry/backoff settings for a single
+// ConnectWithRetry call. A zero value field falls back to the Manager's own
+// MaxRetries/BaseBackoff/MaxBackoff/OnReconnect.
+type ConnectOpts struct {
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	OnReconnect func(*websocket.Conn)
 }
 
 func (m *Manager) Connect() *websocket.Conn {
@@ -49,6 +77,104 @@ func (m *Manager) Connect() *websocket.Conn {
 	return conn
 }
 
+// ConnectWithRetry dials like Connect but keeps retrying on failure with
+// exponential backoff (BaseBackoff doubling up to MaxBackoff, plus jitter)
+// until a connection succeeds, MaxRetries is exhausted or ctx is cancelled.
+// opts fields override the Manager's own retry settings when non-zero.
+// firstConnection should be true only for the very first dial of a fresh
+// Manager/MaintainConnection loop; pass false for every later call, since
+// those represent the Manager reconnecting after a previously live
+// connection dropped. OnReconnect, if set, is invoked with the new
+// connection whenever firstConnection is false, regardless of how many
+// attempts this call itself needed — including when the very next redial
+// succeeds on its first try, which is the common case of a brother server
+// that heals itself quickly. With firstConnection true, OnReconnect is
+// invoked only if the first dial failed and a later attempt succeeded.
+func (m *Manager) ConnectWithRetry(ctx context.Context, firstConnection bool, opts ConnectOpts) *websocket.Conn {
+	maxRetries := m.MaxRetries
+	if opts.MaxRetries != 0 {
+		maxRetries = opts.MaxRetries
+	}
+	base := m.BaseBackoff
+	if opts.BaseBackoff != 0 {
+		base = opts.BaseBackoff
+	}
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	max := m.MaxBackoff
+	if opts.MaxBackoff != 0 {
+		max = opts.MaxBackoff
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	onReconnect := m.OnReconnect
+	if opts.OnReconnect != nil {
+		onReconnect = opts.OnReconnect
+	}
+
+	backoff := base
+	for attempt := 0; maxRetries <= 0 || attempt < maxRetries; attempt++ {
+		conn := m.Connect()
+		if conn != nil {
+			if (attempt > 0 || !firstConnection) && onReconnect != nil {
+				onReconnect(conn)
+			}
+			return conn
+		}
+
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		clog.Warn("HTTPServer", "ConnectWithRetry", "Dial failed, retrying in %s (attempt %d)", wait, attempt+1)
+
+		select {
+		case <-ctx.Done():
+			clog.Info("HTTPServer", "ConnectWithRetry", "Cancelled: %s", ctx.Err())
+			return nil
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > max {
+			backoff = max
+		}
+	}
+
+	clog.Error("HTTPServer", "ConnectWithRetry", "Giving up after %d attempts", maxRetries)
+	return nil
+}
+
+// MaintainConnection dials the brother server with ConnectWithRetry, runs the
+// read/write pumps and hub registration on the resulting client, and
+// transparently redials (re-registering with the hub) whenever the
+// connection drops. It returns when ctx is cancelled or when ConnectWithRetry
+// gives up after MaxRetries attempts; ctx is only checked between
+// connections, so a live connection runs until it drops.
+func (m *Manager) MaintainConnection(ctx context.Context, name string, cta Hub.CallToAction, opts ConnectOpts) {
+	firstConnection := true
+	for {
+		conn := m.ConnectWithRetry(ctx, firstConnection, opts)
+		if conn == nil {
+			return
+		}
+		firstConnection = false
+
+		client := &Hub.Client{Hub: m.Hub, Conn: conn, Quit: make(chan bool),
+			CType: Hub.ClientServer, Send: make(chan []byte, 256), CallToAction: cta, Addr: conn.RemoteAddr().String(),
+			Identified: false, Name: name, Content_id: 0, Front_id: "", App_id: "", Country: "", Mode: Hub.ReadWrite}
+		m.Hub.Register <- client
+		go m.Writer(client)
+		m.Reader(client)
+		m.Hub.Unregister <- client
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
 // readPump pumps messages from the websocket connection to the hub.
 //
 // The application runs readPump in a per-connection goroutine. The application
@@ -71,20 +197,28 @@ func (m *Manager) Reader(c *Hub.Client) {
 	})
 	for {
 		// c.ReadProtect.Lock()
-		// messType, message, err := conn.ReadMessage()
+		messageType, message, err := conn.ReadMessage()
 		// c.ReadProtect.Unlock()
-		_, message, err := conn.ReadMessage()
-		// clog.Debug("HTTPServer", "Writer", "Read from Client %s [%s]: %s", c.Name, c.ID, message)
 		if err != nil {
-			// clog.Error("HTTPServer", "Writer", "Type: %d, error: %v", messType, err)
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
+			if websocket.IsUnexpectedCloseError(err, expectedCloseCodes...) {
+				clog.Warn("HTTPServer", "Reader", "Unexpected close from %s: %s", c.Name, err)
+			} else {
+				clog.Debug("HTTPServer", "Reader", "Connection closed by %s: %s", c.Name, err)
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, Newline, Space, -1))
+		if messageType == websocket.TextMessage {
+			if !utf8.Valid(message) {
+				clog.Warn("HTTPServer", "Reader", "Invalid UTF-8 text frame from %s, closing", c.Name)
+				cm := websocket.FormatCloseMessage(websocket.CloseInvalidFramePayloadData, "invalid UTF-8")
+				conn.WriteControl(websocket.CloseMessage, cm, time.Now().Add(writeWait))
+				break
+			}
+			message = bytes.TrimSpace(bytes.Replace(message, Newline, Space, -1))
+		}
 		// mess := Hub.NewMessage(c.CType, c, message)
 		// c.Hub.Action <- mess
-		go c.CallToAction(c, message)
+		go c.CallToAction(c, messageType, message)
 	}
 }
 
@@ -170,12 +304,33 @@ func (m *Manager) testPage(w http.ResponseWriter, r *http.Request) {
 
 // serveWs handles websocket requests from the peer.
 func (m *Manager) wsConnect(w http.ResponseWriter, r *http.Request, cta Hub.CallToAction) {
+	var identity *Identity
+	if m.Authenticator != nil {
+		var ok bool
+		identity, ok = m.Authenticator.Authenticate(r)
+		if !ok {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
 	httpconn, err := m.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		clog.Error("HTTPServer", "wsConnect", "%s", err)
 		return
 	}
-	name := r.Header["Sec-Websocket-Key"][0]
+
+	var name string
+	if keys := r.Header["Sec-Websocket-Key"]; len(keys) > 0 {
+		name = keys[0]
+	}
+	appID, country, frontID := "", "", ""
+	if identity != nil {
+		name = identity.Name
+		appID = identity.AppID
+		country = identity.Country
+		frontID = identity.FrontID
+	}
 
 	var ua string
 	if len(r.Header["User-Agent"]) > 0 {
@@ -184,14 +339,25 @@ func (m *Manager) wsConnect(w http.ResponseWriter, r *http.Request, cta Hub.Call
 		ua = "n/a"
 	}
 
+	if name == "" {
+		clog.Error("HTTPServer", "wsConnect", "Missing Sec-Websocket-Key and no authenticated identity, refusing connection")
+		httpconn.Close()
+		return
+	}
+
 	if m.Hub.UserExists(name, Hub.ClientUser) {
 		clog.Warn("HTTPServer", "wsConnect", "Client %s already exists ... Refusing connection", name)
 		return
 	}
 
+	if m.EnableCompression {
+		httpconn.EnableWriteCompression(true)
+		httpconn.SetCompressionLevel(m.CompressionLevel)
+	}
+
 	client := &Hub.Client{Hub: m.Hub, Conn: httpconn, Quit: make(chan bool),
 		CType: Hub.ClientUndefined, Send: make(chan []byte, 256), CallToAction: cta, Addr: httpconn.RemoteAddr().String(),
-		Identified: false, Name: name, Content_id: 0, Front_id: "", App_id: "", Country: "", User_agent: ua, Mode: Hub.ReadWrite}
+		Identified: identity != nil, Name: name, Content_id: 0, Front_id: frontID, App_id: appID, Country: country, User_agent: ua, Mode: Hub.ReadWrite}
 	m.Hub.Register <- client
 	go m.Writer(client)
 	m.Reader(client)
@@ -200,13 +366,19 @@ func (m *Manager) wsConnect(w http.ResponseWriter, r *http.Request, cta Hub.Call
 
 func (m *Manager) Start(conf *Manager, cta Hub.CallToAction) {
 	m = conf
+	checkOrigin := func(r *http.Request) bool {
+		return true
+	}
+	if a, ok := m.Authenticator.(*JWTAuthenticator); ok {
+		checkOrigin = a.CheckOrigin
+	}
+
 	m.Upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
-		ReadBufferSize:   m.ReadBufferSize,
-		WriteBufferSize:  m.WriteBufferSize,
-		HandshakeTimeout: time.Duration(m.HandshakeTimeout) * time.Second,
+		CheckOrigin:       checkOrigin,
+		ReadBufferSize:    m.ReadBufferSize,
+		WriteBufferSize:   m.WriteBufferSize,
+		HandshakeTimeout:  time.Duration(m.HandshakeTimeout) * time.Second,
+		EnableCompression: m.EnableCompression,
 	} // use default options
 
 	http.HandleFunc("/test", m.testPage)
@@ -0,0 +1,178 @@
+package HTTPServer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/Djoulzy/Polycom/Config"
+)
+
+func TestJWTAuthenticatorCheckOrigin(t *testing.T) {
+	a := &JWTAuthenticator{AllowedOrigins: []string{"https://*.example.com", "https://app.other.com"}}
+
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://chat.example.com", true},
+		{"https://app.other.com", true},
+		{"https://evil.com", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if got := a.CheckOrigin(r); got != c.want {
+			t.Errorf("CheckOrigin(%q) = %v, want %v", c.origin, got, c.want)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws?token=from-query", nil)
+	if got := bearerToken(r); got != "from-query" {
+		t.Errorf("bearerToken from query = %q, want %q", got, "from-query")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Authorization", "Bearer from-header")
+	if got := bearerToken(r); got != "from-header" {
+		t.Errorf("bearerToken from header = %q, want %q", got, "from-header")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	if got := bearerToken(r); got != "" {
+		t.Errorf("bearerToken with nothing set = %q, want empty", got)
+	}
+}
+
+func TestJWTAuthenticatorAuthenticateOriginRefused(t *testing.T) {
+	a := &JWTAuthenticator{AllowedOrigins: []string{"https://app.example.com"}}
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	r.Header.Set("Authorization", "Bearer whatever")
+
+	if _, ok := a.Authenticate(r); ok {
+		t.Fatal("expected Authenticate to refuse a disallowed origin")
+	}
+}
+
+func TestJWTAuthenticatorAuthenticateMissingToken(t *testing.T) {
+	a := &JWTAuthenticator{AllowedOrigins: []string{"https://app.example.com"}}
+
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+
+	if _, ok := a.Authenticate(r); ok {
+		t.Fatal("expected Authenticate to refuse a request with no token")
+	}
+}
+
+func TestJWTAuthenticatorAuthenticateInvalidToken(t *testing.T) {
+	a := &JWTAuthenticator{
+		AllowedOrigins: []string{"https://app.example.com"},
+		Keyfunc:        func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil },
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/ws?token=not-a-jwt", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+
+	if _, ok := a.Authenticate(r); ok {
+		t.Fatal("expected Authenticate to refuse a malformed token")
+	}
+}
+
+func TestJWTAuthenticatorAuthenticateValidToken(t *testing.T) {
+	secret := []byte("secret")
+	a := &JWTAuthenticator{
+		AllowedOrigins: []string{"https://app.example.com"},
+		Keyfunc:        func(*jwt.Token) (interface{}, error) { return secret, nil },
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      "alice",
+		"app_id":   "chat",
+		"country":  "FR",
+		"front_id": "web",
+	})
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("sign token: %s", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/ws?token="+signed, nil)
+	r.Header.Set("Origin", "https://app.example.com")
+
+	identity, ok := a.Authenticate(r)
+	if !ok {
+		t.Fatal("expected Authenticate to accept a valid token")
+	}
+	if identity.Name != "alice" || identity.AppID != "chat" || identity.Country != "FR" || identity.FrontID != "web" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+}
+
+func TestEncryptionKeyfuncHMAC(t *testing.T) {
+	enc := &Config.Encryption{HEX_KEY: "736563726574"} // "secret" in hex
+	keyfunc, err := encryptionKeyfunc(enc)
+	if err != nil {
+		t.Fatalf("encryptionKeyfunc: %s", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"})
+	signed, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("sign token: %s", err)
+	}
+	if _, err := jwt.Parse(signed, keyfunc); err != nil {
+		t.Fatalf("expected HMAC token to validate, got: %s", err)
+	}
+}
+
+func TestEncryptionKeyfuncRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %s", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal RSA public key: %s", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	enc := &Config.Encryption{RSA_PUBLIC_KEY_PEM: string(pubPEM)}
+	keyfunc, err := encryptionKeyfunc(enc)
+	if err != nil {
+		t.Fatalf("encryptionKeyfunc: %s", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "alice"})
+	signed, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatalf("sign token: %s", err)
+	}
+	if _, err := jwt.Parse(signed, keyfunc); err != nil {
+		t.Fatalf("expected RSA token to validate, got: %s", err)
+	}
+
+	// An HMAC-signed token must be refused once RSA is configured.
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"})
+	hmacSigned, err := hmacToken.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("sign token: %s", err)
+	}
+	if _, err := jwt.Parse(hmacSigned, keyfunc); err == nil {
+		t.Fatal("expected HMAC token to be refused when RSA is configured")
+	}
+}
@@ -0,0 +1,235 @@
+package HTTPServer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Djoulzy/Polycom/Hub"
+)
+
+// These tests re-implement the Autobahn Testsuite cases that matter most for
+// Reader/Writer: fragmented messages, invalid UTF-8 in text frames, oversize
+// frames vs. maxMessageSize, unexpected opcodes and close-code handling.
+// They boot a real Manager on an httptest server rather than the full
+// fuzzingserver/fuzzingclient harness, which needs a JVM and network access
+// unavailable in CI.
+
+func newTestServer(t *testing.T, received chan<- receivedMessage) (*httptest.Server, *Manager) {
+	t.Helper()
+
+	h := &Hub.Hub{
+		Register:   make(chan *Hub.Client),
+		Unregister: make(chan *Hub.Client),
+		Users:      make(map[string]*Hub.Client),
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		for {
+			select {
+			case c := <-h.Register:
+				h.Users[c.Name] = c
+			case c := <-h.Unregister:
+				delete(h.Users, c.Name)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	m := &Manager{
+		Hub:             h,
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+
+	cta := Hub.CallToAction(func(c *Hub.Client, messageType int, message []byte) {
+		received <- receivedMessage{messageType: messageType, payload: append([]byte(nil), message...)}
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		m.Upgrader = websocket.Upgrader{
+			CheckOrigin:      func(r *http.Request) bool { return true },
+			ReadBufferSize:   m.ReadBufferSize,
+			WriteBufferSize:  m.WriteBufferSize,
+			HandshakeTimeout: 5 * time.Second,
+		}
+		m.wsConnect(w, r, cta)
+	})
+
+	server := httptest.NewServer(mux)
+	return server, m
+}
+
+type receivedMessage struct {
+	messageType int
+	payload     []byte
+}
+
+func dialTestServer(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parse server URL: %s", err)
+	}
+	u.Scheme = "ws"
+	u.Path = "/ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	return conn
+}
+
+func TestReaderTextAndBinaryOpcodes(t *testing.T) {
+	received := make(chan receivedMessage, 4)
+	server, _ := newTestServer(t, received)
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatalf("write text: %s", err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte{0x00, 0x01, 0x02}); err != nil {
+		t.Fatalf("write binary: %s", err)
+	}
+
+	// Reader dispatches each message to CallToAction in its own goroutine,
+	// so the two messages may arrive in either order.
+	got := make(map[int]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			got[msg.messageType] = true
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for message %d of 2", i+1)
+		}
+	}
+	if !got[websocket.TextMessage] {
+		t.Fatalf("expected a TextMessage, got types %v", got)
+	}
+	if !got[websocket.BinaryMessage] {
+		t.Fatalf("expected a BinaryMessage, got types %v", got)
+	}
+}
+
+func TestReaderFragmentedTextMessage(t *testing.T) {
+	received := make(chan receivedMessage, 1)
+	server, _ := newTestServer(t, received)
+	defer server.Close()
+
+	// gorilla buffers NextWriter writes and only emits a frame when its write
+	// buffer is full or the writer is closed, so dial with a 4-byte write
+	// buffer: "frag" + "mented" then goes out as the frames "frag", "ment"
+	// and a final "ed".
+	dialer := websocket.Dialer{WriteBufferSize: 4}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	defer conn.Close()
+
+	w, err := conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		t.Fatalf("NextWriter: %s", err)
+	}
+	if _, err := w.Write([]byte("frag")); err != nil {
+		t.Fatalf("write part 1: %s", err)
+	}
+	if _, err := w.Write([]byte("mented")); err != nil {
+		t.Fatalf("write part 2: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close writer: %s", err)
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg.payload) != "fragmented" {
+			t.Fatalf("expected reassembled payload %q, got %q", "fragmented", msg.payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for fragmented message")
+	}
+}
+
+func TestReaderInvalidUTF8TextMessage(t *testing.T) {
+	received := make(chan receivedMessage, 1)
+	server, _ := newTestServer(t, received)
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+
+	invalid := []byte{0xff, 0xfe, 0xfd}
+	if err := conn.WriteMessage(websocket.TextMessage, invalid); err != nil {
+		t.Fatalf("write invalid utf-8: %s", err)
+	}
+
+	// Manager.Reader rejects invalid UTF-8 text frames by sending a
+	// CloseInvalidFramePayloadData close frame; the peer must see the
+	// connection close rather than the malformed payload delivered.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	if err == nil {
+		t.Fatal("expected close error for invalid UTF-8 text frame")
+	}
+	if !websocket.IsCloseError(err, websocket.CloseInvalidFramePayloadData) {
+		t.Fatalf("expected CloseInvalidFramePayloadData, got %s", err)
+	}
+
+	select {
+	case msg := <-received:
+		t.Fatalf("CallToAction should not run for an invalid frame, got %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReaderOversizeFrameIsRejected(t *testing.T) {
+	received := make(chan receivedMessage, 1)
+	server, _ := newTestServer(t, received)
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+
+	oversized := strings.Repeat("x", maxMessageSize+1)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(oversized)); err != nil {
+		t.Fatalf("write oversize message: %s", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	if err == nil {
+		t.Fatal("expected close error for oversize frame")
+	}
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("expected CloseMessageTooBig, got %s", err)
+	}
+}
+
+func TestOversizePingPayloadIsRejectedByClientEncoder(t *testing.T) {
+	received := make(chan receivedMessage, 1)
+	server, _ := newTestServer(t, received)
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+
+	// RFC 6455 caps control frame payloads at 125 bytes.
+	oversizedPing := strings.Repeat("p", 126)
+	if err := conn.WriteControl(websocket.PingMessage, []byte(oversizedPing), time.Now().Add(time.Second)); err == nil {
+		t.Fatal("expected the client-side frame encoder to reject an oversize ping payload")
+	}
+}